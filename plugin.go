@@ -3,14 +3,42 @@ package network_latency_heatmap
 import (
 	"context"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-ping/ping"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
 )
 
+// phiWindowSize bounds the number of inter-arrival samples kept per target
+// when estimating the phi-accrual failure detector's distribution.
+const phiWindowSize = 100
+
+// phiThresholdDefault is the phi score above which a target is flagged
+// "suspect" when the phiThreshold parameter isn't set.
+const phiThresholdDefault = 8.0
+
+// histogramBin is a single latency histogram bucket; Tail is set when this
+// bin genuinely absorbed overflow samples beyond a fixed histogramRangeMs
+// (see buildHistogram) rather than just being the last equal-width bucket.
+type histogramBin struct {
+	LowerMs float64 `json:"lowerMs"`
+	UpperMs float64 `json:"upperMs"`
+	Count   int     `json:"count"`
+	Tail    bool    `json:"tail,omitempty"`
+}
+
 // Execute runs the network latency heatmap plugin
 func Execute(params map[string]interface{}) (interface{}, error) {
 	// Extract parameters with validation and defaults
@@ -55,6 +83,80 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 		showGraph = showGraphParam
 	}
 
+	// Get phiThreshold parameter (default: phiThresholdDefault), used to flag
+	// a target as "suspect" once its phi-accrual failure score crosses it
+	phiThreshold := phiThresholdDefault
+	if phiThresholdParam, ok := params["phiThreshold"].(float64); ok && phiThresholdParam > 0 {
+		phiThreshold = phiThresholdParam
+	}
+
+	// Get normalizationFactor parameter (default: 10), the number of
+	// equal-width histogram buckets to derive from each target's RTT range
+	normalizationFactor := 10
+	if normalizationFactorParam, ok := params["normalizationFactor"].(float64); ok && normalizationFactorParam > 0 {
+		normalizationFactor = int(normalizationFactorParam)
+	}
+
+	// Get histogramRangeMs parameter (default: 0, meaning "use each target's
+	// own observed max"); when set, it caps the bucketed range so samples
+	// above it collapse into a genuine overflow tail bucket instead of just
+	// being the last of nf equal-width buckets spanning the observed range
+	histogramRangeMs := 0.0
+	if histogramRangeMsParam, ok := params["histogramRangeMs"].(float64); ok && histogramRangeMsParam > 0 {
+		histogramRangeMs = histogramRangeMsParam
+	}
+
+	// Get mode parameter (default: "ping"); "mtr" switches to a per-hop
+	// traceroute heatmap instead of a per-target one
+	mode := "ping"
+	if modeParam, ok := params["mode"].(string); ok && modeParam != "" {
+		mode = modeParam
+	}
+
+	if mode == "mtr" {
+		return executeMTR(targets, interval, timeout, packetSize, samples, params)
+	}
+
+	// Get stream parameter (default: false); a streaming caller should use
+	// ExecuteStream instead, which emits results incrementally and never
+	// blocks until every sample across every target has completed
+	if streamParam, ok := params["stream"].(bool); ok && streamParam {
+		return nil, fmt.Errorf("stream mode requires calling ExecuteStream instead of Execute")
+	}
+
+	// Get metricsAddr parameter (default: ""); when set, an embedded
+	// Prometheus exporter is started and updated on every completed sample
+	metricsAddr, _ := params["metricsAddr"].(string)
+	metricsBucketsMs := "1,5,10,25,50,100,250,500,1000,2500"
+	if metricsBucketsMsParam, ok := params["metricsBucketsMs"].(string); ok && metricsBucketsMsParam != "" {
+		metricsBucketsMs = metricsBucketsMsParam
+	}
+
+	// Get privileged parameter (default: "auto"): "true" forces a raw ICMP
+	// socket, "false" forces go-ping's unprivileged UDP mode, and "auto"
+	// probes for CAP_NET_RAW and falls back to the system ping/ping6
+	// binary when it isn't available
+	privileged := "auto"
+	if privilegedParam, ok := params["privileged"].(string); ok && privilegedParam != "" {
+		privileged = privilegedParam
+	}
+	privMode := resolvePrivilegeMode(privileged)
+
+	// Get sourceInterface / sourceAddress parameters, for measuring from a
+	// specific NIC/VLAN on multi-homed hosts. The go-ping library has no
+	// SO_BINDTODEVICE equivalent, so outside fork mode sourceInterface is
+	// resolved to that interface's own address and fed to pinger.Source;
+	// fork mode passes sourceInterface straight through as ping's -I flag.
+	sourceInterface, _ := params["sourceInterface"].(string)
+	sourceAddress, _ := params["sourceAddress"].(string)
+	if sourceInterface != "" && sourceAddress == "" && privMode != privilegeFork {
+		resolved, err := resolveInterfaceAddress(sourceInterface)
+		if err != nil {
+			return nil, fmt.Errorf("sourceInterface: %w", err)
+		}
+		sourceAddress = resolved
+	}
+
 	// Define the results structure
 	type pingResult struct {
 		Target    string    `json:"target"`
@@ -71,6 +173,17 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Start the embedded Prometheus exporter, if requested; it shuts down
+	// automatically when ctx is cancelled above
+	var exporter *prometheusExporter
+	if metricsAddr != "" {
+		var err error
+		exporter, err = newPrometheusExporter(ctx, metricsAddr, metricsBucketsMs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start metrics exporter: %w", err)
+		}
+	}
+
 	// For each target, create a goroutine to ping it repeatedly
 	for _, target := range targets {
 		wg.Add(1)
@@ -86,58 +199,16 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 					// Continue with the ping
 				}
 
-				// Create a new pinger
-				pinger, err := ping.NewPinger(host)
-				if err != nil {
-					// Record a failed ping
-					resultsChan <- pingResult{
-						Target:    host,
-						Timestamp: time.Now(),
-						RTT:       -1,
-						Success:   false,
-					}
-					// Sleep before next sample
-					time.Sleep(time.Duration(interval * float64(time.Second)))
-					continue
-				}
-
-				// Configure the pinger
-				pinger.Count = 1
-				pinger.Size = packetSize
-				pinger.Timeout = time.Duration(timeout * float64(time.Second))
-				pinger.SetPrivileged(true) // May require sudo on some systems
-
-				// Run the ping
-				err = pinger.Run()
-				if err != nil {
-					// Record a failed ping
-					resultsChan <- pingResult{
-						Target:    host,
-						Timestamp: time.Now(),
-						RTT:       -1,
-						Success:   false,
-					}
-				} else {
-					// Get statistics
-					stats := pinger.Statistics()
-					if stats.PacketsRecv > 0 {
-						// Record a successful ping
-						resultsChan <- pingResult{
-							Target:    host,
-							Timestamp: time.Now(),
-							RTT:       float64(stats.AvgRtt.Microseconds()) / 1000.0, // Convert to milliseconds
-							Success:   true,
-						}
-					} else {
-						// Record a failed ping (timeout)
-						resultsChan <- pingResult{
-							Target:    host,
-							Timestamp: time.Now(),
-							RTT:       -1,
-							Success:   false,
-						}
-					}
+				// Ping once, using whichever privilege mode was resolved
+				// above, and record the result
+				rtt, success := ping1(ctx, host, privMode, timeout, packetSize, sourceInterface, sourceAddress)
+				resultsChan <- pingResult{
+					Target:    host,
+					Timestamp: time.Now(),
+					RTT:       rtt,
+					Success:   success,
 				}
+				exporter.record(host, rtt, success)
 
 				// Sleep before next sample
 				time.Sleep(time.Duration(interval * float64(time.Second)))
@@ -173,15 +244,25 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 
 	// Calculate statistics for each target
 	type targetStats struct {
-		Target     string    `json:"target"`
-		MinRTT     float64   `json:"minRtt"`     // in milliseconds
-		AvgRTT     float64   `json:"avgRtt"`     // in milliseconds
-		MaxRTT     float64   `json:"maxRtt"`     // in milliseconds
-		MedianRTT  float64   `json:"medianRtt"`  // in milliseconds
-		Jitter     float64   `json:"jitter"`     // in milliseconds
-		PacketLoss float64   `json:"packetLoss"` // percentage
-		RTTs       []float64 `json:"rtts"`       // all RTTs for visualization
-		Timestamps []string  `json:"timestamps"` // all timestamps for visualization
+		Target     string         `json:"target"`
+		MinRTT     float64        `json:"minRtt"`     // in milliseconds
+		AvgRTT     float64        `json:"avgRtt"`     // in milliseconds
+		MaxRTT     float64        `json:"maxRtt"`     // in milliseconds
+		MedianRTT  float64        `json:"medianRtt"`  // in milliseconds
+		P50        float64        `json:"p50"`        // 50th percentile RTT, in milliseconds
+		P90        float64        `json:"p90"`        // 90th percentile RTT, in milliseconds
+		P95        float64        `json:"p95"`        // 95th percentile RTT, in milliseconds
+		P99        float64        `json:"p99"`        // 99th percentile RTT, in milliseconds
+		P999       float64        `json:"p999"`       // 99.9th percentile RTT, in milliseconds
+		Histogram  []histogramBin `json:"histogram"`  // RTT distribution, tail-normalized
+		Jitter     float64        `json:"jitter"`     // mean absolute deviation, in milliseconds
+		RFCJitter  float64        `json:"rfcJitter"`  // RFC 3550 interarrival jitter, in milliseconds
+		PacketLoss float64        `json:"packetLoss"` // percentage
+		Phi        float64        `json:"phi"`        // phi-accrual failure score at the last sample
+		Suspect    bool           `json:"suspect"`    // true if the final phi exceeds phiThreshold
+		PhiHistory []float64      `json:"phiHistory"` // phi score alongside each sample, for charting
+		RTTs       []float64      `json:"rtts"`       // all RTTs for visualization
+		Timestamps []string       `json:"timestamps"` // all timestamps for visualization
 	}
 
 	var allStats []targetStats
@@ -196,6 +277,14 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 		minRTT := float64(9999999)
 		maxRTT := float64(-1)
 
+		// Phi-accrual failure detection state: a bounded window of
+		// inter-arrival intervals between successful replies, used to
+		// estimate how overdue the next reply is at any point in time
+		var arrivalIntervals []float64
+		var lastArrival time.Time
+		var phiHistory []float64
+		phi := 0.0
+
 		for _, r := range res {
 			timestamps = append(timestamps, r.Timestamp.Format(time.RFC3339))
 
@@ -210,21 +299,40 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 				if r.RTT > maxRTT {
 					maxRTT = r.RTT
 				}
+
+				if !lastArrival.IsZero() {
+					phi = phiScore(arrivalIntervals, r.Timestamp.Sub(lastArrival).Seconds())
+					arrivalIntervals = append(arrivalIntervals, r.Timestamp.Sub(lastArrival).Seconds())
+					if len(arrivalIntervals) > phiWindowSize {
+						arrivalIntervals = arrivalIntervals[len(arrivalIntervals)-phiWindowSize:]
+					}
+				}
+				lastArrival = r.Timestamp
 			} else {
 				// For visualization, use -1 to indicate failed pings
 				rtts = append(rtts, -1)
+
+				if !lastArrival.IsZero() {
+					phi = phiScore(arrivalIntervals, r.Timestamp.Sub(lastArrival).Seconds())
+				}
 			}
+
+			phiHistory = append(phiHistory, roundFloat(phi, 2))
 		}
 
 		// Calculate average, median, and jitter
 		avgRTT := 0.0
 		medianRTT := 0.0
 		jitter := 0.0
+		rfcJitter := 0.0
+		var p50, p90, p95, p99, p999 float64
+		var histogram []histogramBin
 
 		if successCount > 0 {
 			avgRTT = totalRTT / float64(successCount)
 
-			// Calculate median
+			// Build the time-ordered list of successful RTTs first, since
+			// RFC 3550 jitter depends on arrival order rather than value
 			successRTTs := make([]float64, 0, successCount)
 			for _, rtt := range rtts {
 				if rtt >= 0 {
@@ -232,6 +340,15 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 				}
 			}
 
+			// RFC 3550 style jitter: J += (|D| - J)/16, where D is the
+			// difference between consecutive RTT samples
+			if len(successRTTs) > 1 {
+				for i := 1; i < len(successRTTs); i++ {
+					d := successRTTs[i] - successRTTs[i-1]
+					rfcJitter += (absFloat(d) - rfcJitter) / 16
+				}
+			}
+
 			if len(successRTTs) > 0 {
 				sort.Float64s(successRTTs)
 				if len(successRTTs)%2 == 0 {
@@ -246,6 +363,14 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 					totalDev += absFloat(rtt - avgRTT)
 				}
 				jitter = totalDev / float64(len(successRTTs))
+
+				p50 = percentile(successRTTs, 50)
+				p90 = percentile(successRTTs, 90)
+				p95 = percentile(successRTTs, 95)
+				p99 = percentile(successRTTs, 99)
+				p999 = percentile(successRTTs, 99.9)
+
+				histogram = buildHistogram(successRTTs, normalizationFactor, histogramRangeMs)
 			}
 		}
 
@@ -267,8 +392,18 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 			AvgRTT:     roundFloat(avgRTT, 2),
 			MaxRTT:     roundFloat(maxRTT, 2),
 			MedianRTT:  roundFloat(medianRTT, 2),
+			P50:        roundFloat(p50, 2),
+			P90:        roundFloat(p90, 2),
+			P95:        roundFloat(p95, 2),
+			P99:        roundFloat(p99, 2),
+			P999:       roundFloat(p999, 2),
+			Histogram:  histogram,
 			Jitter:     roundFloat(jitter, 2),
+			RFCJitter:  roundFloat(rfcJitter, 2),
 			PacketLoss: roundFloat(packetLoss, 2),
+			Phi:        roundFloat(phi, 2),
+			Suspect:    phi > phiThreshold,
+			PhiHistory: phiHistory,
 			RTTs:       rtts,
 			Timestamps: timestamps,
 		})
@@ -339,20 +474,980 @@ func Execute(params map[string]interface{}) (interface{}, error) {
 
 	// Prepare final result structure
 	result := map[string]interface{}{
-		"targets":     targets,
-		"interval":    interval,
-		"samples":     samples,
-		"timeout":     timeout,
-		"packetSize":  packetSize,
-		"statistics":  allStats,
-		"heatmapData": heatmap,
-		"showGraph":   showGraph,
-		"timestamp":   time.Now().Format(time.RFC3339),
+		"targets":             targets,
+		"interval":            interval,
+		"samples":             samples,
+		"timeout":             timeout,
+		"packetSize":          packetSize,
+		"statistics":          allStats,
+		"heatmapData":         heatmap,
+		"showGraph":           showGraph,
+		"phiThreshold":        phiThreshold,
+		"normalizationFactor": normalizationFactor,
+		"histogramRangeMs":    histogramRangeMs,
+		"metricsAddr":         metricsAddr,
+		"privileged":          privileged,
+		"timestamp":           time.Now().Format(time.RFC3339),
 	}
 
 	return result, nil
 }
 
+// privilegeMode is how a single ping sample should be taken, resolved once
+// per Execute/ExecuteStream call from the privileged parameter.
+type privilegeMode int
+
+const (
+	// privilegeRaw uses a privileged raw ICMP socket (requires CAP_NET_RAW).
+	privilegeRaw privilegeMode = iota
+	// privilegeUDP uses go-ping's unprivileged UDP datagram socket mode.
+	privilegeUDP
+	// privilegeFork shells out to the system ping/ping6 binary; "auto" picks
+	// it when a raw ICMP socket can't be opened (UDP mode is not tried).
+	privilegeFork
+)
+
+// resolvePrivilegeMode turns the privileged parameter ("auto", "true", or
+// "false") into a concrete privilegeMode. "auto" probes for a raw ICMP
+// socket and falls back to fork-exec when one can't be opened (e.g. no
+// CAP_NET_RAW).
+func resolvePrivilegeMode(setting string) privilegeMode {
+	switch setting {
+	case "true":
+		return privilegeRaw
+	case "false":
+		return privilegeUDP
+	default:
+		if canOpenRawICMPSocket() {
+			return privilegeRaw
+		}
+		return privilegeFork
+	}
+}
+
+// canOpenRawICMPSocket reports whether this process can open a raw ICMP
+// socket, which requires CAP_NET_RAW (or running as root) on Linux.
+func canOpenRawICMPSocket() bool {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// resolveInterfaceAddress returns the first IPv4 address bound to the named
+// network interface. The go-ping library has no SO_BINDTODEVICE equivalent,
+// so outside fork mode this is how sourceInterface gets turned into
+// something pingLibrary can actually bind to via pinger.Source.
+func resolveInterfaceAddress(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("resolve interface %q: %w", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("resolve interface %q: %w", name, err)
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("interface %q has no IPv4 address", name)
+}
+
+// ping1 takes a single ping sample against host using the resolved
+// privilege mode, returning its RTT in milliseconds (or -1 on failure) and
+// whether it succeeded.
+func ping1(ctx context.Context, host string, mode privilegeMode, timeout float64, packetSize int, sourceInterface, sourceAddress string) (float64, bool) {
+	switch mode {
+	case privilegeFork:
+		return pingFork(ctx, host, timeout, packetSize, sourceInterface, sourceAddress)
+	default:
+		return pingLibrary(host, mode == privilegeRaw, timeout, packetSize, sourceAddress)
+	}
+}
+
+// pingLibrary takes a single ping sample using the go-ping library, in
+// either its privileged raw-socket mode or its unprivileged UDP mode.
+func pingLibrary(host string, privileged bool, timeout float64, packetSize int, sourceAddress string) (float64, bool) {
+	pinger, err := ping.NewPinger(host)
+	if err != nil {
+		return -1, false
+	}
+
+	pinger.Count = 1
+	pinger.Size = packetSize
+	pinger.Timeout = time.Duration(timeout * float64(time.Second))
+	pinger.SetPrivileged(privileged)
+	if sourceAddress != "" {
+		pinger.Source = sourceAddress
+	}
+
+	if err := pinger.Run(); err != nil {
+		return -1, false
+	}
+
+	stats := pinger.Statistics()
+	if stats.PacketsRecv == 0 {
+		return -1, false
+	}
+
+	return float64(stats.AvgRtt.Microseconds()) / 1000.0, true
+}
+
+// pingTimeRe extracts the round-trip time from a ping/ping6 reply line such
+// as "64 bytes from 1.1.1.1: icmp_seq=1 ttl=59 time=12.3 ms".
+var pingTimeRe = regexp.MustCompile(`time[=<]([0-9.]+)\s*ms`)
+
+// pingFork shells out to the system ping (or ping6, for IPv6 literals)
+// binary and parses its output for a "time=" line. Under "auto" it is used
+// whenever this process cannot open a raw ICMP socket (no CAP_NET_RAW).
+func pingFork(ctx context.Context, host string, timeout float64, packetSize int, sourceInterface, sourceAddress string) (float64, bool) {
+	binary := "ping"
+	if strings.Contains(host, ":") {
+		binary = "ping6"
+	}
+
+	args := []string{
+		"-c", "1",
+		"-W", strconv.Itoa(int(math.Ceil(timeout))),
+		"-s", strconv.Itoa(packetSize),
+	}
+	if sourceInterface != "" {
+		args = append(args, "-I", sourceInterface)
+	}
+	if sourceAddress != "" {
+		args = append(args, "-S", sourceAddress)
+	}
+	args = append(args, host)
+
+	output, _ := exec.CommandContext(ctx, binary, args...).CombinedOutput()
+	return parsePingForkOutput(string(output))
+}
+
+// parsePingForkOutput extracts the RTT from a single round of ping/ping6
+// output. A missing "time=" line (timeout, unreachable, 100% packet loss)
+// is reported as a failed sample.
+func parsePingForkOutput(output string) (float64, bool) {
+	match := pingTimeRe.FindStringSubmatch(output)
+	if match == nil {
+		return -1, false
+	}
+
+	rtt, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return -1, false
+	}
+
+	return rtt, true
+}
+
+// hopStats holds the aggregated RTT statistics for a single traceroute hop,
+// across every round an mtr-mode run performed against a target.
+type hopStats struct {
+	Hop        int       `json:"hop"`
+	Address    string    `json:"address"`
+	Hostname   string    `json:"hostname,omitempty"`
+	MinRTT     float64   `json:"minRtt"`     // in milliseconds
+	AvgRTT     float64   `json:"avgRtt"`     // in milliseconds
+	MaxRTT     float64   `json:"maxRtt"`     // in milliseconds
+	PacketLoss float64   `json:"packetLoss"` // percentage
+	RTTs       []float64 `json:"rtts"`       // per-round RTTs, -1 for a missed reply
+}
+
+// targetHopHeatmap is the mtr-mode equivalent of heatmapData: rows are hops
+// instead of targets, columns are traceroute rounds instead of ping samples.
+type targetHopHeatmap struct {
+	Target      string      `json:"target"`
+	Timestamps  []string    `json:"timestamps"`  // one per round
+	Hops        []hopStats  `json:"hops"`        // per-hop aggregates, in hop order
+	LatencyData [][]float64 `json:"latencyData"` // [hop][round] RTT, -1 for a miss
+	MinLatency  float64     `json:"minLatency"`
+	MaxLatency  float64     `json:"maxLatency"`
+}
+
+// executeMTR runs a continuous per-hop traceroute against each target,
+// sampling every hop `samples` times (one "round" per sample), and returns a
+// heatmap per target where rows are hops rather than a single endpoint RTT.
+func executeMTR(targets []string, interval, timeout float64, packetSize, samples int, params map[string]interface{}) (interface{}, error) {
+	// Get maxHops parameter (default: 30)
+	maxHops := 30
+	if maxHopsParam, ok := params["maxHops"].(float64); ok && maxHopsParam > 0 {
+		maxHops = int(maxHopsParam)
+	}
+
+	timestamps := make([]string, samples)
+	var wg sync.WaitGroup
+	results := make([]targetHopHeatmap, len(targets))
+
+	for t, target := range targets {
+		wg.Add(1)
+		go func(idx int, host string) {
+			defer wg.Done()
+
+			// Each target gets its own socket: icmp.PacketConn's TTL and
+			// read-deadline options are socket-wide, and ReadFrom has no
+			// per-probe demultiplexing, so sharing one connection across
+			// concurrent targets would race and cross-attribute replies
+			conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+			if err != nil {
+				results[idx] = targetHopHeatmap{Target: host}
+				return
+			}
+			defer conn.Close()
+
+			results[idx] = traceroute(conn, host, maxHops, samples, interval, timeout, packetSize)
+		}(t, target)
+	}
+	wg.Wait()
+
+	for i := range timestamps {
+		timestamps[i] = time.Now().Format(time.RFC3339)
+	}
+
+	result := map[string]interface{}{
+		"targets":    targets,
+		"mode":       "mtr",
+		"maxHops":    maxHops,
+		"interval":   interval,
+		"samples":    samples,
+		"timeout":    timeout,
+		"packetSize": packetSize,
+		"hops":       results,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+
+	return result, nil
+}
+
+// traceroute performs `samples` rounds of an increasing-TTL ICMP traceroute
+// against host, recording per-hop RTT samples and resolving each hop's
+// reverse DNS name once it is first seen.
+func traceroute(conn *icmp.PacketConn, host string, maxHops, samples int, interval, timeout float64, packetSize int) targetHopHeatmap {
+	dst, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return targetHopHeatmap{Target: host}
+	}
+
+	hops := make([]*hopStats, maxHops)
+	latencyData := make([][]float64, maxHops)
+	for h := range hops {
+		hops[h] = &hopStats{Hop: h + 1, MinRTT: 9999999}
+		latencyData[h] = make([]float64, samples)
+		for r := range latencyData[h] {
+			latencyData[h][r] = -1
+		}
+	}
+
+	timestamps := make([]string, samples)
+	reachedHops := maxHops
+
+	for round := 0; round < samples; round++ {
+		timestamps[round] = time.Now().Format(time.RFC3339)
+
+		for ttl := 1; ttl <= reachedHops; ttl++ {
+			addr, rtt, done, ok := probeHop(conn, dst, ttl, packetSize, time.Duration(timeout*float64(time.Second)))
+			hop := hops[ttl-1]
+
+			if ok {
+				latencyData[ttl-1][round] = roundFloat(rtt, 2)
+				hop.RTTs = append(hop.RTTs, roundFloat(rtt, 2))
+				if rtt < hop.MinRTT {
+					hop.MinRTT = rtt
+				}
+				if rtt > hop.MaxRTT {
+					hop.MaxRTT = rtt
+				}
+				if hop.Address == "" && addr != "" {
+					hop.Address = addr
+					if names, err := net.LookupAddr(addr); err == nil && len(names) > 0 {
+						hop.Hostname = strings.TrimSuffix(names[0], ".")
+					}
+				}
+			} else {
+				hop.RTTs = append(hop.RTTs, -1)
+			}
+
+			if done {
+				reachedHops = ttl
+				break
+			}
+		}
+
+		time.Sleep(time.Duration(interval * float64(time.Second)))
+	}
+
+	result := targetHopHeatmap{
+		Target:      host,
+		Timestamps:  timestamps,
+		LatencyData: latencyData[:reachedHops],
+		MinLatency:  9999999,
+		MaxLatency:  0,
+	}
+
+	for h := 0; h < reachedHops; h++ {
+		hop := hops[h]
+		if len(hop.RTTs) > 0 {
+			hop.PacketLoss = roundFloat(float64(countMisses(hop.RTTs))/float64(len(hop.RTTs))*100, 2)
+		}
+		if hop.MinRTT == 9999999 {
+			hop.MinRTT = 0
+		}
+		hop.MinRTT = roundFloat(hop.MinRTT, 2)
+		hop.MaxRTT = roundFloat(hop.MaxRTT, 2)
+		if len(hop.RTTs) > 0 {
+			var total float64
+			var successCount int
+			for _, rtt := range hop.RTTs {
+				if rtt >= 0 {
+					total += rtt
+					successCount++
+				}
+			}
+			if successCount > 0 {
+				hop.AvgRTT = roundFloat(total/float64(successCount), 2)
+			}
+		}
+
+		result.Hops = append(result.Hops, *hop)
+
+		for _, rtt := range hop.RTTs {
+			if rtt > 0 {
+				if rtt < result.MinLatency {
+					result.MinLatency = rtt
+				}
+				if rtt > result.MaxLatency {
+					result.MaxLatency = rtt
+				}
+			}
+		}
+	}
+
+	if result.MinLatency == 9999999 || result.MaxLatency == 0 {
+		result.MinLatency = 0
+		result.MaxLatency = 100
+	}
+
+	return result
+}
+
+// countMisses counts the entries in rtts that represent a missed reply.
+func countMisses(rtts []float64) int {
+	misses := 0
+	for _, rtt := range rtts {
+		if rtt < 0 {
+			misses++
+		}
+	}
+	return misses
+}
+
+// probeHop sends a single ICMP echo request at the given TTL and waits for
+// either a TIME_EXCEEDED reply (an intermediate hop) or an ECHO_REPLY (the
+// destination was reached). It returns the replying address, the RTT in
+// milliseconds, whether the destination has been reached, and whether a
+// reply matching this probe was received (the first packet read decides).
+func probeHop(conn *icmp.PacketConn, dst *net.IPAddr, ttl, packetSize int, timeout time.Duration) (address string, rttMs float64, reachedDestination bool, ok bool) {
+	if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return "", 0, false, false
+	}
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   ttl,
+			Seq:  ttl,
+			Data: make([]byte, packetSize),
+		},
+	}
+
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return "", 0, false, false
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(wb, dst); err != nil {
+		return "", 0, false, false
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", 0, false, false
+	}
+
+	rb := make([]byte, 1500)
+	n, peer, err := conn.ReadFrom(rb)
+	if err != nil {
+		return "", 0, false, false
+	}
+
+	rtt := float64(time.Since(start).Microseconds()) / 1000.0
+
+	reply, err := icmp.ParseMessage(1, rb[:n])
+	if err != nil {
+		return "", 0, false, false
+	}
+
+	// A raw ICMP socket receives a copy of every inbound ICMP packet on the
+	// host, not just replies to what this conn sent, so a reply has to be
+	// matched against this probe before it's trusted: an echo reply must
+	// come from dst itself, and a time-exceeded reply embeds the original
+	// datagram, whose destination must be dst and whose ID/Seq we set to
+	// ttl when it was sent.
+	switch reply.Type {
+	case ipv4.ICMPTypeTimeExceeded:
+		body, ok := reply.Body.(*icmp.TimeExceeded)
+		if !ok || !matchesEmbeddedEcho(body.Data, dst.IP, ttl) {
+			return "", 0, false, false
+		}
+		return peer.String(), rtt, false, true
+	case ipv4.ICMPTypeEchoReply:
+		if peer.String() != dst.String() {
+			return "", 0, false, false
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.ID != ttl || echo.Seq != ttl {
+			return "", 0, false, false
+		}
+		return peer.String(), rtt, true, true
+	default:
+		return "", 0, false, false
+	}
+}
+
+// matchesEmbeddedEcho reports whether data — the original datagram embedded
+// in a TimeExceeded reply's body — is the echo request this probe sent,
+// by checking the embedded IP header's destination against dst and the
+// embedded ICMP header's ID and Seq against ttl (the value probeHop uses
+// for both fields on the outgoing echo request).
+func matchesEmbeddedEcho(data []byte, dst net.IP, ttl int) bool {
+	if len(data) < 20 {
+		return false
+	}
+	if !net.IP(data[16:20]).Equal(dst) {
+		return false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	if len(data) < ihl+8 {
+		return false
+	}
+
+	header := data[ihl:]
+	id := int(header[4])<<8 | int(header[5])
+	seq := int(header[6])<<8 | int(header[7])
+	return id == ttl && seq == ttl
+}
+
+// Event is implemented by every event ExecuteStream emits on its output
+// channel: SampleEvent as each ping completes, StatsEvent periodically per
+// target, and a final SummaryEvent once the run ends.
+type Event interface {
+	EventType() string
+}
+
+// SampleEvent reports a single completed ping.
+type SampleEvent struct {
+	Target    string    `json:"target"`
+	Timestamp time.Time `json:"timestamp"`
+	RTT       float64   `json:"rtt"`     // in milliseconds, -1 on failure
+	Success   bool      `json:"success"` // true if the ping succeeded
+}
+
+// EventType identifies a SampleEvent on the ExecuteStream channel.
+func (SampleEvent) EventType() string { return "sample" }
+
+// rollingStats is the running view of a target's RTT distribution,
+// maintained in O(1) space so long-running streams never retain the full
+// sample history.
+type rollingStats struct {
+	Target       string  `json:"target"`
+	Count        int64   `json:"count"`
+	SuccessCount int64   `json:"successCount"`
+	MinRTT       float64 `json:"minRtt"`    // in milliseconds
+	AvgRTT       float64 `json:"avgRtt"`    // in milliseconds
+	MaxRTT       float64 `json:"maxRtt"`    // in milliseconds
+	StdDevRTT    float64 `json:"stdDevRtt"` // in milliseconds
+	P50RTT       float64 `json:"p50Rtt"`    // in milliseconds, P² estimate
+	P90RTT       float64 `json:"p90Rtt"`    // in milliseconds, P² estimate
+	PacketLoss   float64 `json:"packetLoss"`
+}
+
+// StatsEvent reports a target's rolling statistics, emitted periodically
+// (every statsInterval seconds) while a target's stream is running.
+type StatsEvent struct {
+	Target string       `json:"target"`
+	Stats  rollingStats `json:"stats"`
+}
+
+// EventType identifies a StatsEvent on the ExecuteStream channel.
+func (StatsEvent) EventType() string { return "stats" }
+
+// SummaryEvent reports every target's final rolling statistics once
+// ExecuteStream returns.
+type SummaryEvent struct {
+	Stats map[string]rollingStats `json:"stats"`
+}
+
+// EventType identifies a SummaryEvent on the ExecuteStream channel.
+func (SummaryEvent) EventType() string { return "summary" }
+
+// targetAggregator maintains O(1)-space running RTT statistics for a single
+// target using Welford's algorithm for mean/variance and a pair of P²
+// quantile estimators, so a streaming session can run indefinitely without
+// accumulating an unbounded slice of samples.
+type targetAggregator struct {
+	count        int64
+	successCount int64
+	mean         float64 // Welford's running mean, in milliseconds
+	m2           float64 // Welford's running sum of squared deviations
+	minRTT       float64
+	maxRTT       float64
+	p50          *p2Quantile
+	p90          *p2Quantile
+}
+
+func newTargetAggregator() *targetAggregator {
+	return &targetAggregator{
+		minRTT: 9999999,
+		p50:    newP2Quantile(0.5),
+		p90:    newP2Quantile(0.9),
+	}
+}
+
+// add folds a single sample into the running aggregates.
+func (a *targetAggregator) add(rtt float64, success bool) {
+	a.count++
+	if !success {
+		return
+	}
+
+	a.successCount++
+	delta := rtt - a.mean
+	a.mean += delta / float64(a.successCount)
+	a.m2 += delta * (rtt - a.mean)
+
+	if rtt < a.minRTT {
+		a.minRTT = rtt
+	}
+	if rtt > a.maxRTT {
+		a.maxRTT = rtt
+	}
+
+	a.p50.add(rtt)
+	a.p90.add(rtt)
+}
+
+// stats snapshots the current aggregates for target.
+func (a *targetAggregator) stats(target string) rollingStats {
+	stddev := 0.0
+	if a.successCount > 1 {
+		stddev = math.Sqrt(a.m2 / float64(a.successCount-1))
+	}
+
+	minRTT := a.minRTT
+	if a.successCount == 0 {
+		minRTT = 0
+	}
+
+	packetLoss := 0.0
+	if a.count > 0 {
+		packetLoss = float64(a.count-a.successCount) / float64(a.count) * 100
+	}
+
+	return rollingStats{
+		Target:       target,
+		Count:        a.count,
+		SuccessCount: a.successCount,
+		MinRTT:       roundFloat(minRTT, 2),
+		AvgRTT:       roundFloat(a.mean, 2),
+		MaxRTT:       roundFloat(a.maxRTT, 2),
+		StdDevRTT:    roundFloat(stddev, 2),
+		P50RTT:       roundFloat(a.p50.value(), 2),
+		P90RTT:       roundFloat(a.p90.value(), 2),
+		PacketLoss:   roundFloat(packetLoss, 2),
+	}
+}
+
+// p2Quantile is an incremental estimator for a single quantile p, using
+// Jain & Chlamtac's P² algorithm. It tracks only five markers, giving an
+// O(1)-space running estimate instead of requiring the full sorted sample
+// history that the batch percentile() helper needs.
+type p2Quantile struct {
+	p     float64
+	n     [5]float64
+	np    [5]float64
+	dn    [5]float64
+	q     [5]float64
+	count int
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	return &p2Quantile{
+		p:  p,
+		dn: [5]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+// add folds a new observation into the estimator.
+func (pq *p2Quantile) add(x float64) {
+	if pq.count < 5 {
+		pq.q[pq.count] = x
+		pq.count++
+		if pq.count == 5 {
+			sort.Float64s(pq.q[:])
+			for i := range pq.n {
+				pq.n[i] = float64(i + 1)
+			}
+			pq.np = [5]float64{1, 1 + 2*pq.p, 1 + 4*pq.p, 3 + 2*pq.p, 5}
+		}
+		return
+	}
+
+	var k int
+	switch {
+	case x < pq.q[0]:
+		pq.q[0] = x
+		k = 0
+	case x >= pq.q[4]:
+		pq.q[4] = x
+		k = 3
+	default:
+		for i := 0; i < 4; i++ {
+			if pq.q[i] <= x && x < pq.q[i+1] {
+				k = i
+				break
+			}
+		}
+	}
+
+	for i := k + 1; i < 5; i++ {
+		pq.n[i]++
+	}
+	for i := range pq.np {
+		pq.np[i] += pq.dn[i]
+	}
+
+	for i := 1; i < 4; i++ {
+		d := pq.np[i] - pq.n[i]
+		if (d >= 1 && pq.n[i+1]-pq.n[i] > 1) || (d <= -1 && pq.n[i-1]-pq.n[i] < -1) {
+			sign := 1.0
+			if d < 0 {
+				sign = -1.0
+			}
+
+			qNew := pq.parabolic(i, sign)
+			if pq.q[i-1] < qNew && qNew < pq.q[i+1] {
+				pq.q[i] = qNew
+			} else {
+				pq.q[i] = pq.linear(i, sign)
+			}
+			pq.n[i] += sign
+		}
+	}
+}
+
+// parabolic computes the P² algorithm's parabolic-prediction adjustment for
+// marker i moving by d (+1 or -1).
+func (pq *p2Quantile) parabolic(i int, d float64) float64 {
+	return pq.q[i] + d/(pq.n[i+1]-pq.n[i-1])*((pq.n[i]-pq.n[i-1]+d)*(pq.q[i+1]-pq.q[i])/(pq.n[i+1]-pq.n[i])+
+		(pq.n[i+1]-pq.n[i]-d)*(pq.q[i]-pq.q[i-1])/(pq.n[i]-pq.n[i-1]))
+}
+
+// linear falls back to linear interpolation when the parabolic prediction
+// would violate marker ordering.
+func (pq *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return pq.q[i] + d*(pq.q[j]-pq.q[i])/(pq.n[j]-pq.n[i])
+}
+
+// value returns the current quantile estimate.
+func (pq *p2Quantile) value() float64 {
+	if pq.count == 0 {
+		return 0
+	}
+	if pq.count < 5 {
+		sorted := append([]float64(nil), pq.q[:pq.count]...)
+		sort.Float64s(sorted)
+		return percentile(sorted, pq.p*100)
+	}
+	return pq.q[2]
+}
+
+// ExecuteStream runs the same repeated-ping collection as Execute but emits
+// results incrementally on out as they arrive, instead of blocking until
+// every sample across every target has completed. Set samples to 0 to run
+// until ctx is cancelled, which lets a live dashboard consume a continuous
+// stream without the process accumulating unbounded memory.
+func ExecuteStream(ctx context.Context, params map[string]interface{}, out chan<- Event) error {
+	targetsStr, ok := params["targets"].(string)
+	if !ok || targetsStr == "" {
+		return fmt.Errorf("target hosts parameter is required")
+	}
+
+	targets := strings.Split(targetsStr, ",")
+	for i, target := range targets {
+		targets[i] = strings.TrimSpace(target)
+	}
+
+	// Get interval parameter (default: 1 second)
+	interval := 1.0
+	if intervalParam, ok := params["interval"].(float64); ok && intervalParam > 0 {
+		interval = intervalParam
+	}
+
+	// Get samples parameter (default: 30); 0 means run forever
+	samples := 30
+	if samplesParam, ok := params["samples"].(float64); ok && samplesParam >= 0 {
+		samples = int(samplesParam)
+	}
+
+	// Get timeout parameter (default: 2 seconds)
+	timeout := 2.0
+	if timeoutParam, ok := params["timeout"].(float64); ok && timeoutParam > 0 {
+		timeout = timeoutParam
+	}
+
+	// Get packet size parameter (default: 56 bytes)
+	packetSize := 56
+	if packetSizeParam, ok := params["packetSize"].(float64); ok && packetSizeParam > 0 {
+		packetSize = int(packetSizeParam)
+	}
+
+	// Get statsInterval parameter (default: 5 seconds), how often a
+	// StatsEvent is emitted for a target while it is streaming
+	statsInterval := 5.0
+	if statsIntervalParam, ok := params["statsInterval"].(float64); ok && statsIntervalParam > 0 {
+		statsInterval = statsIntervalParam
+	}
+
+	// Get privileged, sourceInterface, and sourceAddress parameters; see
+	// resolvePrivilegeMode and ping1 for their meaning
+	privileged := "auto"
+	if privilegedParam, ok := params["privileged"].(string); ok && privilegedParam != "" {
+		privileged = privilegedParam
+	}
+	privMode := resolvePrivilegeMode(privileged)
+	sourceInterface, _ := params["sourceInterface"].(string)
+	sourceAddress, _ := params["sourceAddress"].(string)
+	if sourceInterface != "" && sourceAddress == "" && privMode != privilegeFork {
+		resolved, err := resolveInterfaceAddress(sourceInterface)
+		if err != nil {
+			return fmt.Errorf("sourceInterface: %w", err)
+		}
+		sourceAddress = resolved
+	}
+
+	// Get metricsAddr parameter (default: ""); when set, an embedded
+	// Prometheus exporter is started and updated on every completed sample.
+	// Streaming mode is the common case for a long-lived scrape target, so
+	// it shuts down on ctx cancellation the same way the stream itself does.
+	metricsAddr, _ := params["metricsAddr"].(string)
+	metricsBucketsMs := "1,5,10,25,50,100,250,500,1000,2500"
+	if metricsBucketsMsParam, ok := params["metricsBucketsMs"].(string); ok && metricsBucketsMsParam != "" {
+		metricsBucketsMs = metricsBucketsMsParam
+	}
+	var exporter *prometheusExporter
+	if metricsAddr != "" {
+		var err error
+		exporter, err = newPrometheusExporter(ctx, metricsAddr, metricsBucketsMs)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics exporter: %w", err)
+		}
+	}
+
+	aggregators := make(map[string]*targetAggregator, len(targets))
+	var mu sync.Mutex
+	for _, target := range targets {
+		aggregators[target] = newTargetAggregator()
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			lastStats := time.Now()
+			for i := 0; samples == 0 || i < samples; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+
+				rtt, success := ping1(ctx, host, privMode, timeout, packetSize, sourceInterface, sourceAddress)
+
+				now := time.Now()
+				// A caller that cancels ctx may reasonably stop draining out
+				// right away, so these sends must not block forever on it.
+				select {
+				case out <- SampleEvent{Target: host, Timestamp: now, RTT: rtt, Success: success}:
+				case <-ctx.Done():
+					return
+				}
+				exporter.record(host, rtt, success)
+
+				mu.Lock()
+				aggregators[host].add(rtt, success)
+				if now.Sub(lastStats).Seconds() >= statsInterval {
+					select {
+					case out <- StatsEvent{Target: host, Stats: aggregators[host].stats(host)}:
+						lastStats = now
+					case <-ctx.Done():
+						mu.Unlock()
+						return
+					}
+				}
+				mu.Unlock()
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Duration(interval * float64(time.Second))):
+				}
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	summary := make(map[string]rollingStats, len(aggregators))
+	for target, agg := range aggregators {
+		summary[target] = agg.stats(target)
+	}
+	mu.Unlock()
+
+	select {
+	case out <- SummaryEvent{Stats: summary}:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// phiScore computes the phi-accrual failure detector's suspicion level for a
+// target, given its recent history of inter-arrival intervals (in seconds)
+// and the time elapsed (in seconds) since the last successful reply. It
+// models the interval distribution as normal and returns
+// phi = -log10(1 - CDF(elapsed)), per the algorithm used by Cassandra/Akka.
+func phiScore(intervals []float64, elapsed float64) float64 {
+	if len(intervals) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range intervals {
+		sum += v
+	}
+	mean := sum / float64(len(intervals))
+
+	var variance float64
+	for _, v := range intervals {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(intervals))
+	stddev := math.Sqrt(variance)
+
+	// Guard against a degenerate (near-zero variance) distribution
+	if stddev < 0.001 {
+		stddev = 0.001
+	}
+
+	cdf := 0.5 * (1 + math.Erf((elapsed-mean)/(stddev*math.Sqrt2)))
+	// Clamp to avoid log10(0) when the distribution is saturated; this still
+	// leaves headroom up to phi ~16, comfortably above the default threshold
+	if cdf > 1-1e-16 {
+		cdf = 1 - 1e-16
+	}
+
+	return -math.Log10(1 - cdf)
+}
+
+// percentile returns the nearest-rank value for p (0-100) from a slice of
+// RTTs that is already sorted ascending.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+// buildHistogram divides sorted, a sorted slice of successful RTTs, into nf
+// equal-width buckets. rangeMs optionally fixes the upper bound of the
+// bucketed range to something narrower than the observed max (an expected
+// "normal" RTT ceiling, say); samples above it collapse into the last of the
+// nf buckets, which then also holds that bucket's own in-range samples and
+// is flagged as a genuine overflow tail. rangeMs <= 0 (or >= the observed max) falls back to
+// spanning [min, max] as before — in that case nothing can ever exceed the
+// bucketed range by construction, so no bucket is flagged as a tail.
+func buildHistogram(sorted []float64, nf int, rangeMs float64) []histogramBin {
+	if len(sorted) == 0 || nf <= 0 {
+		return nil
+	}
+
+	min := sorted[0]
+	max := sorted[len(sorted)-1]
+
+	if rangeMs > 0 && rangeMs < min {
+		// Every sample already exceeds the fixed range: it's all overflow.
+		return []histogramBin{{LowerMs: min, UpperMs: max, Count: len(sorted), Tail: true}}
+	}
+
+	hi := max
+	genuineTail := false
+	if rangeMs > 0 && rangeMs < max {
+		hi = rangeMs
+		genuineTail = true
+	}
+
+	if hi == min || nf == 1 {
+		return []histogramBin{{LowerMs: min, UpperMs: max, Count: len(sorted), Tail: genuineTail}}
+	}
+
+	width := (hi - min) / float64(nf)
+	bins := make([]histogramBin, nf-1)
+	for i := range bins {
+		bins[i] = histogramBin{
+			LowerMs: roundFloat(min+float64(i)*width, 2),
+			UpperMs: roundFloat(min+float64(i+1)*width, 2),
+		}
+	}
+	tail := histogramBin{
+		LowerMs: roundFloat(min+float64(nf-1)*width, 2),
+		UpperMs: roundFloat(max, 2),
+		Tail:    genuineTail,
+	}
+
+	for _, rtt := range sorted {
+		idx := int((rtt - min) / width)
+		if idx >= nf-1 {
+			tail.Count++
+			continue
+		}
+		bins[idx].Count++
+	}
+
+	return append(bins, tail)
+}
+
 // Helper function for absolute value of float64
 func absFloat(x float64) float64 {
 	if x < 0 {
@@ -361,6 +1456,138 @@ func absFloat(x float64) float64 {
 	return x
 }
 
+// prometheusExporter publishes per-target ping metrics in Prometheus text
+// format so operators can scrape this plugin from an existing Prometheus
+// stack instead of re-polling the JSON result. A nil *prometheusExporter is
+// valid and its methods are no-ops, so callers can use it unconditionally
+// whether or not metricsAddr was set.
+type prometheusExporter struct {
+	server     *http.Server
+	rtt        *prometheus.HistogramVec
+	up         *prometheus.GaugeVec
+	packetLoss *prometheus.GaugeVec
+	jitter     *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	counts   map[string][2]int64 // [total, failed] samples per target
+	lastRTT  map[string]float64  // last observed RTT per target, in milliseconds
+	jitterMs map[string]float64  // RFC 3550 style running jitter per target, in milliseconds
+}
+
+// newPrometheusExporter registers the netscout_ping_* collectors on a registry
+// of its own and starts an HTTP server on addr serving that registry at
+// /metrics via promhttp.HandlerFor; the process-wide default registry that
+// promhttp.Handler() serves is not used. The server is shut down
+// automatically once ctx is cancelled.
+func newPrometheusExporter(ctx context.Context, addr, bucketsMsCSV string) (*prometheusExporter, error) {
+	registry := prometheus.NewRegistry()
+
+	e := &prometheusExporter{
+		rtt: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "netscout_ping_rtt_seconds",
+			Help:    "Ping round-trip time in seconds",
+			Buckets: parseBucketsMs(bucketsMsCSV),
+		}, []string{"target"}),
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netscout_ping_up",
+			Help: "1 if the last ping to the target succeeded, 0 otherwise",
+		}, []string{"target"}),
+		packetLoss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netscout_ping_packet_loss_ratio",
+			Help: "Fraction of pings to the target that have failed, 0-1",
+		}, []string{"target"}),
+		jitter: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netscout_ping_jitter_seconds",
+			Help: "RFC 3550 style interarrival jitter in seconds",
+		}, []string{"target"}),
+		counts:   make(map[string][2]int64),
+		lastRTT:  make(map[string]float64),
+		jitterMs: make(map[string]float64),
+	}
+
+	registry.MustRegister(e.rtt, e.up, e.packetLoss, e.jitter)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	e.server = &http.Server{Addr: addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	// Give the listener a brief moment to fail fast on a bad address
+	select {
+	case err := <-errCh:
+		return nil, err
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = e.server.Shutdown(shutdownCtx)
+	}()
+
+	return e, nil
+}
+
+// record folds a single completed sample into the exporter's metrics. It is
+// a no-op on a nil receiver so callers don't need to guard every call site
+// on whether metricsAddr was set.
+func (e *prometheusExporter) record(target string, rttMs float64, success bool) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := e.counts[target]
+	counts[0]++
+	up := 0.0
+	if success {
+		up = 1.0
+	} else {
+		counts[1]++
+	}
+	e.counts[target] = counts
+	e.up.WithLabelValues(target).Set(up)
+	e.packetLoss.WithLabelValues(target).Set(float64(counts[1]) / float64(counts[0]))
+
+	if success {
+		e.rtt.WithLabelValues(target).Observe(rttMs / 1000.0)
+
+		if last, ok := e.lastRTT[target]; ok {
+			d := rttMs - last
+			j := e.jitterMs[target]
+			j += (absFloat(d) - j) / 16
+			e.jitterMs[target] = j
+			e.jitter.WithLabelValues(target).Set(j / 1000.0)
+		}
+		e.lastRTT[target] = rttMs
+	}
+}
+
+// parseBucketsMs parses a comma-separated list of millisecond bucket bounds
+// (as accepted by the metricsBucketsMs parameter) into second-denominated
+// Prometheus histogram buckets.
+func parseBucketsMs(csv string) []float64 {
+	parts := strings.Split(csv, ",")
+	buckets := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		ms, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, ms/1000.0)
+	}
+	return buckets
+}
+
 // Helper function to round float to specified decimal places
 func roundFloat(x float64, decimals int) float64 {
 	// Quick implementation for rounding
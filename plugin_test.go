@@ -0,0 +1,86 @@
+package network_latency_heatmap
+
+import "testing"
+
+func TestPhiScoreSuspectWhenOverdue(t *testing.T) {
+	intervals := make([]float64, 20)
+	for i := range intervals {
+		intervals[i] = 1.0 // a steady 1s interval history
+	}
+
+	phi := phiScore(intervals, 20.0) // 20x the mean interval with no reply
+	if phi <= phiThresholdDefault {
+		t.Fatalf("expected phi > %v for a target 20x overdue, got %v", phiThresholdDefault, phi)
+	}
+}
+
+func TestPhiScoreNotSuspectWhenOnTime(t *testing.T) {
+	intervals := make([]float64, 20)
+	for i := range intervals {
+		intervals[i] = 1.0
+	}
+
+	phi := phiScore(intervals, 1.0)
+	if phi > phiThresholdDefault {
+		t.Fatalf("expected phi <= %v for an on-time reply, got %v", phiThresholdDefault, phi)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{10, 20, 30, 40, 50}
+
+	if got := percentile(sorted, 50); got != 30 {
+		t.Errorf("p50 = %v, want 30", got)
+	}
+	if got := percentile(sorted, 100); got != 50 {
+		t.Errorf("p100 = %v, want 50", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of empty slice = %v, want 0", got)
+	}
+}
+
+func TestBuildHistogramBinsAndCounts(t *testing.T) {
+	sorted := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	bins := buildHistogram(sorted, 5, 0)
+	if len(bins) != 5 {
+		t.Fatalf("expected 5 bins, got %d", len(bins))
+	}
+
+	var total int
+	for _, bin := range bins {
+		total += bin.Count
+		if bin.Tail {
+			t.Errorf("no bin should be flagged Tail when spanning the observed range")
+		}
+	}
+	if total != len(sorted) {
+		t.Errorf("bin counts sum to %d, want %d", total, len(sorted))
+	}
+}
+
+func TestBuildHistogramGenuineOverflowTail(t *testing.T) {
+	sorted := []float64{0, 1, 2, 3, 4, 20, 30}
+
+	bins := buildHistogram(sorted, 5, 5)
+	last := bins[len(bins)-1]
+	if !last.Tail {
+		t.Fatalf("expected last bin to be flagged Tail when rangeMs caps the range")
+	}
+	if last.Count != 3 {
+		t.Errorf("expected 3 samples in the tail (4 from the last bucket, 20 and 30 overflowing), got %d", last.Count)
+	}
+}
+
+func TestP2QuantileApproximatesMedian(t *testing.T) {
+	pq := newP2Quantile(0.5)
+	for i := 1; i <= 100; i++ {
+		pq.add(float64(i))
+	}
+
+	got := pq.value()
+	if got < 45 || got > 55 {
+		t.Errorf("p2Quantile(0.5) over 1..100 = %v, want ~50", got)
+	}
+}